@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/form3tech-oss/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+	elastic "gopkg.in/olivere/elastic.v3"
+
+	"github.com/yvettewang/Around/config"
+	"github.com/yvettewang/Around/tokens"
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+const (
+	USER_INDEX = "user"
+	USER_TYPE  = "user"
+)
+
+// User is the ES document backing signup/login. Password is always the
+// bcrypt hash, never the plaintext the client submitted.
+type User struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// tokenPair is what /login and /refresh hand back to the client.
+type tokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// keySet, refreshStore and revocationChecker are set up in main() and
+// shared by every auth handler below.
+var (
+	keySet            *tokens.KeySet
+	refreshStore      tokens.RefreshStore
+	revocationChecker *tokens.RevocationChecker
+)
+
+func esClient() (*elastic.Client, error) {
+	cfg := config.Get()
+	return elastic.NewClient(elastic.SetURL(cfg.Elasticsearch.URLs...), elastic.SetSniff(false))
+}
+
+func signupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", corsOrigin())
+
+	var u User
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil || u.Username == "" || u.Password == "" {
+		http.Error(w, "invalid username or password", http.StatusBadRequest)
+		return
+	}
+
+	client, err := esClient()
+	if err != nil {
+		http.Error(w, "ES is not setup", http.StatusInternalServerError)
+		return
+	}
+
+	exists, err := client.Get().Index(USER_INDEX).Type(USER_TYPE).Id(u.Username).Do()
+	if err == nil && exists.Found {
+		http.Error(w, "username already exists", http.StatusConflict)
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = client.Index().
+		Index(USER_INDEX).
+		Type(USER_TYPE).
+		Id(u.Username).
+		BodyJson(User{Username: u.Username, Password: string(hashed)}).
+		Refresh(true).
+		Do()
+	if err != nil {
+		http.Error(w, "failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", corsOrigin())
+
+	var u User
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil || u.Username == "" || u.Password == "" {
+		http.Error(w, "invalid username or password", http.StatusBadRequest)
+		return
+	}
+
+	client, err := esClient()
+	if err != nil {
+		http.Error(w, "ES is not setup", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := client.Get().Index(USER_INDEX).Type(USER_TYPE).Id(u.Username).Do()
+	if err != nil || !result.Found {
+		http.Error(w, "invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	var stored User
+	if err := json.Unmarshal(*result.Source, &stored); err != nil {
+		http.Error(w, "failed to read user record", http.StatusInternalServerError)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte(u.Password)) != nil {
+		http.Error(w, "invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	pair, err := issueTokenPair(r.Context(), u.Username)
+	if err != nil {
+		http.Error(w, "failed to issue tokens", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(pair)
+}
+
+// refreshHandler exchanges a still-valid, unrevoked refresh token for a
+// fresh access token without requiring the user to log in again.
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", corsOrigin())
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		http.Error(w, "missing refresh token", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := parseRefreshToken(body.RefreshToken)
+	if err != nil {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	revoked, err := revocationChecker.IsRevoked(ctx, claims.Id)
+	if err != nil {
+		http.Error(w, "failed to check token revocation", http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		http.Error(w, "refresh token has been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	valid, err := refreshStore.Verify(ctx, claims.Username, claims.Id, body.RefreshToken)
+	if err != nil || !valid {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	accessToken, _, err := keySet.NewAccessToken(claims.Username, claims.Id)
+	if err != nil {
+		http.Error(w, "failed to issue access token", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(tokenPair{AccessToken: accessToken})
+}
+
+// logoutHandler revokes a refresh token's jti so it can no longer be
+// exchanged for new access tokens. Every access token minted alongside it
+// (or reissued from it via /refresh) shares that same jti, so
+// RevocationMiddleware starts rejecting them immediately too, instead of
+// letting the last-issued access token keep working until its own TTL
+// expires.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", corsOrigin())
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		http.Error(w, "missing refresh token", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := parseRefreshToken(body.RefreshToken)
+	if err != nil {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	if err := revocationChecker.Revoke(ctx, claims.Id); err != nil {
+		http.Error(w, "failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if err := refreshStore.Delete(ctx, claims.Username, claims.Id); err != nil {
+		http.Error(w, "failed to delete refresh token", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// issueTokenPair mints a fresh access/refresh pair for username, sharing the
+// refresh token's jti as the access token's own jti (see NewAccessToken), and
+// persists the refresh token's hash so refreshHandler can verify it later.
+func issueTokenPair(ctx context.Context, username string) (tokenPair, error) {
+	refreshToken, refreshClaims, err := keySet.NewRefreshToken(username)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	accessToken, _, err := keySet.NewAccessToken(username, refreshClaims.Id)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if err := refreshStore.Save(ctx, username, refreshClaims.Id, refreshToken); err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// parseRefreshToken verifies signature and kid via keySet, then checks the
+// token actually is a refresh token and not an access token being misused.
+func parseRefreshToken(raw string) (*tokens.Claims, error) {
+	var claims tokens.Claims
+	token, err := jwt.ParseWithClaims(raw, &claims, keySet.Keyfunc)
+	if err != nil || !token.Valid || claims.Type != "refresh" {
+		return nil, errInvalidRefreshToken
+	}
+	return &claims, nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
+)
+
+// BlobStore is the common interface every object storage backend implements.
+// handlerPost only talks to this interface, so the concrete provider (GCS,
+// S3, Azure Blob, Swift, or the in-memory fake used by tests) is chosen once
+// at startup and swapped without touching handler code.
+type BlobStore interface {
+	Put(ctx context.Context, name string, r io.Reader) (url string, err error)
+}
+
+// StorageConfig carries whatever a provider needs to authenticate and locate
+// where uploads should land. Not every field applies to every provider.
+type StorageConfig struct {
+	Provider string // "gcs", "s3", "azure", "swift" or "fake"
+
+	// GCS
+	GCSBucket string
+
+	// S3 / S3-compatible (MinIO, Aliyun OSS)
+	S3Bucket          string
+	S3Region          string
+	S3Endpoint        string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+
+	// Azure Blob
+	AzureAccountName   string
+	AzureAccountKey    string
+	AzureContainerName string
+
+	// OpenStack Swift
+	SwiftUsername  string
+	SwiftPassword  string
+	SwiftTenant    string
+	SwiftDomain    string
+	SwiftAuthURL   string
+	SwiftContainer string
+}
+
+// NewBlobStore builds the BlobStore selected by cfg.Provider.
+func NewBlobStore(cfg StorageConfig) (BlobStore, error) {
+	switch cfg.Provider {
+	case "gcs":
+		return &gcsBlobStore{bucketName: cfg.GCSBucket}, nil
+	case "s3":
+		return newS3BlobStore(cfg)
+	case "azure":
+		return newAzureBlobStore(cfg)
+	case "swift":
+		return newSwiftBlobStore(cfg)
+	case "fake", "":
+		return newFakeBlobStore(), nil
+	default:
+		return nil, fmt.Errorf("blobstore: unknown provider %q", cfg.Provider)
+	}
+}
+
+// gcsBlobStore is the original Google Cloud Storage backend, now behind
+// BlobStore instead of being called directly from handlerPost.
+type gcsBlobStore struct {
+	bucketName string
+}
+
+func (b *gcsBlobStore) Put(ctx context.Context, name string, r io.Reader) (string, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	bucket := client.Bucket(b.bucketName)
+	if _, err := bucket.Attrs(ctx); err != nil {
+		return "", err
+	}
+	obj := bucket.Object(name)
+	wc := obj.NewWriter(ctx)
+	if _, err := io.Copy(wc, r); err != nil {
+		return "", err
+	}
+	if err := wc.Close(); err != nil {
+		return "", err
+	}
+	if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return "", err
+	}
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Post is saved to GCS: %s\n", attrs.MediaLink)
+	return attrs.MediaLink, nil
+}
+
+// s3BlobStore uploads via the AWS SDK. A custom endpoint lets it target
+// MinIO or Aliyun OSS instead of AWS itself.
+type s3BlobStore struct {
+	bucketName string
+	client     *s3.S3
+}
+
+func newS3BlobStore(cfg StorageConfig) (*s3BlobStore, error) {
+	awsCfg := aws.NewConfig().WithRegion(cfg.S3Region)
+	if cfg.S3AccessKeyID != "" {
+		awsCfg = awsCfg.WithCredentials(credentials.NewStaticCredentials(cfg.S3AccessKeyID, cfg.S3SecretAccessKey, ""))
+	}
+	if cfg.S3Endpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.S3Endpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &s3BlobStore{bucketName: cfg.S3Bucket, client: s3.New(sess)}, nil
+}
+
+func (b *s3BlobStore) Put(ctx context.Context, name string, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	_, err = b.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(name),
+		Body:   bytes.NewReader(data),
+		ACL:    aws.String("public-read"),
+	})
+	if err != nil {
+		return "", err
+	}
+	req, _ := b.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(name),
+	})
+	// Presign requires a positive expiry; a 0 duration always returns
+	// InvalidPresignExpireError. 7 days is the longest SigV4 allows.
+	url, err := req.Presign(7 * 24 * time.Hour)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Post is saved to S3: %s\n", url)
+	return url, nil
+}
+
+// azureBlobStore uploads to Azure Blob Storage and returns a SAS URL that
+// grants public read access to the blob.
+type azureBlobStore struct {
+	containerURL  azblob.ContainerURL
+	containerName string
+	accountName   string
+	accountKey    string
+}
+
+func newAzureBlobStore(cfg StorageConfig) (*azureBlobStore, error) {
+	credential, err := azblob.NewSharedKeyCredential(cfg.AzureAccountName, cfg.AzureAccountKey)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	u, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", cfg.AzureAccountName, cfg.AzureContainerName))
+	if err != nil {
+		return nil, err
+	}
+	return &azureBlobStore{
+		containerURL:  azblob.NewContainerURL(*u, pipeline),
+		containerName: cfg.AzureContainerName,
+		accountName:   cfg.AzureAccountName,
+		accountKey:    cfg.AzureAccountKey,
+	}, nil
+}
+
+func (b *azureBlobStore) Put(ctx context.Context, name string, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	blobURL := b.containerURL.NewBlockBlobURL(name)
+	if _, err := blobURL.Upload(ctx, bytes.NewReader(data), azblob.BlobHTTPHeaders{}, azblob.Metadata{}, azblob.BlobAccessConditions{}); err != nil {
+		return "", err
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(b.accountName, b.accountKey)
+	if err != nil {
+		return "", err
+	}
+	sas, err := azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPS,
+		ExpiryTime:    time.Now().UTC().Add(24 * 365 * time.Hour),
+		ContainerName: b.containerName,
+		BlobName:      name,
+		Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+	}.NewSASQueryParameters(credential)
+	if err != nil {
+		return "", err
+	}
+	url := blobURL.URL()
+	url.RawQuery = sas.Encode()
+	fmt.Printf("Post is saved to Azure Blob: %s\n", url.String())
+	return url.String(), nil
+}
+
+// swiftBlobStore mirrors Cortex's openstack/swift_object_client: authenticate
+// with gophercloud, then PUT directly into a container via the object
+// storage v1 API.
+type swiftBlobStore struct {
+	client    *gophercloud.ServiceClient
+	container string
+}
+
+func newSwiftBlobStore(cfg StorageConfig) (*swiftBlobStore, error) {
+	authOpts := gophercloud.AuthOptions{
+		IdentityEndpoint: cfg.SwiftAuthURL,
+		Username:         cfg.SwiftUsername,
+		Password:         cfg.SwiftPassword,
+		TenantName:       cfg.SwiftTenant,
+		DomainName:       cfg.SwiftDomain,
+	}
+	provider, err := openstack.AuthenticatedClient(authOpts)
+	if err != nil {
+		return nil, err
+	}
+	client, err := openstack.NewObjectStorageV1(provider, gophercloud.EndpointOpts{})
+	if err != nil {
+		return nil, err
+	}
+	return &swiftBlobStore{client: client, container: cfg.SwiftContainer}, nil
+}
+
+func (b *swiftBlobStore) Put(ctx context.Context, name string, r io.Reader) (string, error) {
+	res := objects.Create(b.client, b.container, name, &objects.CreateOpts{Content: r})
+	if res.Err != nil {
+		return "", res.Err
+	}
+	url := b.client.ServiceURL(b.container, name)
+	fmt.Printf("Post is saved to Swift: %s\n", url)
+	return url, nil
+}
+
+// fakeBlobStore is an in-memory stand-in analogous to fake-gcs-server, so
+// handlerPost can be exercised in tests without cloud credentials.
+type fakeBlobStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeBlobStore() *fakeBlobStore {
+	return &fakeBlobStore{objects: make(map[string][]byte)}
+}
+
+func (b *fakeBlobStore) Put(ctx context.Context, name string, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	b.objects[name] = data
+	b.mu.Unlock()
+	return "fake://" + name, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestFakeBlobStorePut(t *testing.T) {
+	store, err := NewBlobStore(StorageConfig{Provider: "fake"})
+	if err != nil {
+		t.Fatalf("NewBlobStore: %v", err)
+	}
+
+	url, err := store.Put(context.Background(), "post-1.jpg", bytes.NewReader([]byte("image bytes")))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url != "fake://post-1.jpg" {
+		t.Errorf("Put returned url %q, want fake://post-1.jpg", url)
+	}
+}
+
+func TestNewBlobStoreUnknownProvider(t *testing.T) {
+	if _, err := NewBlobStore(StorageConfig{Provider: "carrier-pigeon"}); err == nil {
+		t.Error("NewBlobStore with an unknown provider should return an error")
+	}
+}
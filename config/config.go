@@ -0,0 +1,210 @@
+// Package config loads the service's YAML configuration and keeps it live:
+// a SIGHUP reloads config.yaml from disk and atomically swaps it in, so
+// operators can change endpoints, timeouts, or the spam word list without
+// restarting the process.
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Config mirrors config.yaml. Every field that used to be a hardcoded
+// constant in main.go now lives here.
+type Config struct {
+	Server struct {
+		Addr string `mapstructure:"addr"`
+		HTTP struct {
+			ReadHeaderTimeout time.Duration `mapstructure:"readHeaderTimeout"`
+			ReadTimeout       time.Duration `mapstructure:"readTimeout"`
+			WriteTimeout      time.Duration `mapstructure:"writeTimeout"`
+		} `mapstructure:"http"`
+		TLS struct {
+			CertFile string `mapstructure:"certFile"`
+			KeyFile  string `mapstructure:"keyFile"`
+		} `mapstructure:"tls"`
+	} `mapstructure:"server"`
+
+	Elasticsearch struct {
+		URLs []string `mapstructure:"urls"`
+	} `mapstructure:"elasticsearch"`
+
+	GCS struct {
+		Bucket string `mapstructure:"bucket"`
+	} `mapstructure:"gcs"`
+
+	// Storage selects the BlobStore backend main() builds. Provider
+	// defaults to "gcs" so existing deployments that only set gcs.bucket
+	// keep working unchanged; set storage.provider to switch to s3, azure,
+	// swift, or fake without recompiling.
+	Storage struct {
+		Provider string `mapstructure:"provider"`
+
+		S3 struct {
+			Bucket          string `mapstructure:"bucket"`
+			Region          string `mapstructure:"region"`
+			Endpoint        string `mapstructure:"endpoint"`
+			AccessKeyID     string `mapstructure:"accessKeyId"`
+			SecretAccessKey string `mapstructure:"secretAccessKey"`
+		} `mapstructure:"s3"`
+
+		Azure struct {
+			AccountName   string `mapstructure:"accountName"`
+			AccountKey    string `mapstructure:"accountKey"`
+			ContainerName string `mapstructure:"containerName"`
+		} `mapstructure:"azure"`
+
+		Swift struct {
+			Username  string `mapstructure:"username"`
+			Password  string `mapstructure:"password"`
+			Tenant    string `mapstructure:"tenant"`
+			Domain    string `mapstructure:"domain"`
+			AuthURL   string `mapstructure:"authUrl"`
+			Container string `mapstructure:"container"`
+		} `mapstructure:"swift"`
+	} `mapstructure:"storage"`
+
+	BigTable struct {
+		ProjectID string `mapstructure:"projectId"`
+		Instance  string `mapstructure:"instance"`
+	} `mapstructure:"bigtable"`
+
+	Search struct {
+		DefaultDistance string `mapstructure:"defaultDistance"`
+	} `mapstructure:"search"`
+
+	Pipeline struct {
+		NatsURL           string `mapstructure:"natsUrl"`
+		Subject           string `mapstructure:"subject"`
+		DeadLetterSubject string `mapstructure:"deadLetterSubject"`
+		Workers           int    `mapstructure:"workers"`
+	} `mapstructure:"pipeline"`
+
+	Auth struct {
+		// SigningKeys maps kid -> key material, so an old key can stay
+		// valid for in-flight tokens while ActiveKid moves to a new one.
+		SigningKeys map[string]string `mapstructure:"signingKeys"`
+		ActiveKid   string            `mapstructure:"activeKid"`
+	} `mapstructure:"auth"`
+
+	Moderation struct {
+		WordListPath     string   `mapstructure:"wordListPath"`
+		RegexPatterns    []string `mapstructure:"regexPatterns"`
+		RemoteClassifier struct {
+			Endpoint    string        `mapstructure:"endpoint"`
+			Threshold   float64       `mapstructure:"threshold"`
+			Timeout     time.Duration `mapstructure:"timeout"`
+			MaxFailures int           `mapstructure:"maxFailures"`
+			Cooldown    time.Duration `mapstructure:"cooldown"`
+		} `mapstructure:"remoteClassifier"`
+	} `mapstructure:"moderation"`
+
+	CORS struct {
+		AllowedOrigins []string `mapstructure:"allowedOrigins"`
+	} `mapstructure:"cors"`
+}
+
+var current atomic.Pointer[Config]
+
+// reloadHooks are run, in registration order, after every successful SIGHUP
+// reload. main() uses this to rebuild the package-level state it built once
+// from the startup config - the spam filter, most notably - so a reload
+// actually takes effect instead of only updating what config.Get() returns.
+var reloadHooks []func(*Config)
+
+// OnReload registers fn to run after every config reload, including ones
+// that happen after Init returns. fn is also expected to be safe to call
+// concurrently with itself if SIGHUPs can overlap; a reload that doesn't
+// need a hook (e.g. fields only ever read via Get()) doesn't need one.
+func OnReload(fn func(*Config)) {
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// Init loads path for the first time, stores it as the active config, and
+// starts a goroutine that reloads on SIGHUP. It must be called once before
+// Get.
+func Init(path string) error {
+	cfg, err := load(path)
+	if err != nil {
+		return err
+	}
+	current.Store(cfg)
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			cfg, err := load(path)
+			if err != nil {
+				log.Printf("config: reload of %s failed, keeping old config: %v\n", path, err)
+				continue
+			}
+			current.Store(cfg)
+			for _, hook := range reloadHooks {
+				hook(cfg)
+			}
+			log.Printf("config: reloaded %s\n", path)
+		}
+	}()
+	return nil
+}
+
+// Get returns the currently active config. Safe to call concurrently with a
+// reload in progress; callers always see a complete, consistent snapshot.
+func Get() *Config {
+	return current.Load()
+}
+
+func load(path string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	v.AutomaticEnv()
+
+	setDefaults(v)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, err
+	}
+
+	// viper's AutomaticEnv only overrides a key with an env var matching
+	// that key's own path (e.g. AUTH_SIGNINGKEYS); it doesn't interpolate
+	// a "${VAR}" placeholder written inside a YAML value. Signing keys use
+	// that placeholder so the actual secret never has to be committed to
+	// config.yaml, so expand it here.
+	for kid, key := range cfg.Auth.SigningKeys {
+		cfg.Auth.SigningKeys[kid] = os.ExpandEnv(key)
+	}
+
+	return &cfg, nil
+}
+
+// envKeyReplacer maps an env var like ELASTICSEARCH_URLS to the config key
+// elasticsearch.urls, so every setting can be overridden without editing
+// config.yaml.
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.addr", ":8080")
+	v.SetDefault("storage.provider", "gcs")
+	v.SetDefault("server.http.readHeaderTimeout", 5*time.Second)
+	v.SetDefault("search.defaultDistance", "200km")
+	v.SetDefault("pipeline.subject", "posts.created")
+	v.SetDefault("pipeline.deadLetterSubject", "posts.created.dead")
+	v.SetDefault("pipeline.workers", 4)
+	v.SetDefault("moderation.remoteClassifier.timeout", 2*time.Second)
+	v.SetDefault("moderation.remoteClassifier.maxFailures", 3)
+	v.SetDefault("moderation.remoteClassifier.cooldown", 30*time.Second)
+}
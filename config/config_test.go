@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestConfig writes a minimal config.yaml with a ${VAR}-style signing
+// key placeholder, mirroring how config.yaml keeps the real secret out of
+// the repo.
+func writeTestConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	body := `
+auth:
+  activeKid: "2026-07"
+  signingKeys:
+    2026-07: "${AROUND_TEST_SIGNING_KEY}"
+`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadExpandsSigningKeyEnvPlaceholder(t *testing.T) {
+	t.Setenv("AROUND_TEST_SIGNING_KEY", "super-secret")
+
+	cfg, err := load(writeTestConfig(t))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	got := cfg.Auth.SigningKeys["2026-07"]
+	if got != "super-secret" {
+		t.Errorf("signing key = %q, want %q", got, "super-secret")
+	}
+}
+
+func TestLoadLeavesUnsetPlaceholderEmpty(t *testing.T) {
+	os.Unsetenv("AROUND_TEST_SIGNING_KEY_UNSET")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	body := `
+auth:
+  activeKid: "k1"
+  signingKeys:
+    k1: "${AROUND_TEST_SIGNING_KEY_UNSET}"
+`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg, err := load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// os.ExpandEnv expands an unset var to "", the same behavior a shell
+	// gives an unset variable - it doesn't error, and it doesn't leave the
+	// literal "${...}" in place.
+	if got := cfg.Auth.SigningKeys["k1"]; got != "" {
+		t.Errorf("signing key = %q, want empty string for an unset env var", got)
+	}
+}
+
+func TestLoadDefaultsStorageProviderToGCS(t *testing.T) {
+	cfg, err := load(writeTestConfig(t))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Storage.Provider != "gcs" {
+		t.Errorf("Storage.Provider = %q, want %q", cfg.Storage.Provider, "gcs")
+	}
+}
@@ -4,22 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/form3tech-oss/jwt-go"
 	"github.com/gorilla/mux"
 
 	"cloud.google.com/go/bigtable"
-	"cloud.google.com/go/storage"
+	"github.com/nats-io/nats.go"
 
 	"github.com/pborman/uuid"
 	elastic "gopkg.in/olivere/elastic.v3"
+
+	"github.com/yvettewang/Around/config"
+	"github.com/yvettewang/Around/moderation"
+	"github.com/yvettewang/Around/pipeline"
+	"github.com/yvettewang/Around/tokens"
 )
 
 type Location struct {
@@ -28,29 +34,53 @@ type Location struct {
 }
 
 type Post struct {
-	User     string   `json:"user"`
-	Message  string   `json:"message"`
-	Location Location `json:"location"`
-	Url      string   `json:"url"`
+	User      string   `json:"user"`
+	Message   string   `json:"message"`
+	Location  Location `json:"location"`
+	Url       string   `json:"url"`
+	Timestamp int64    `json:"timestamp"` // unix seconds, set by handlerPost
 }
 
 const (
-	INDEX       = "around"
-	TYPE        = "post"
-	DISTANCE    = "200km"
-	ES_URL      = "http://35.238.255.23:9200"
-	BUCKET_NAME = "post-images-237801"
-	PROJECT_ID  = "around-237801"
-	BT_INSTANCE = "around-post"
+	INDEX = "around"
+	TYPE  = "post"
 )
 
-// Variable with capital letter is exported, like public
+// blobStore is the active object storage backend, selected in main() below.
+// handlerPost uploads through it instead of calling a provider SDK directly.
+var blobStore BlobStore
+
+// natsConn and statusStore are set up in main() and used by handlerPost to
+// publish PostCreated events and by handlerPostStatus to poll ingestion
+// progress. The actual ES/BigTable writes happen in the worker pool
+// started by main(), not in the request path.
+var (
+	natsConn    *nats.Conn
+	statusStore pipeline.StatusStore
+)
 
-var mySigningKey = []byte("long-secret")
+// spamFilter is the active moderation.Filter, built in main() from the
+// word list, regex patterns, and remote classifier configured in
+// config.yaml, and rebuilt by the config.OnReload hook below on every
+// SIGHUP. It's an atomic.Pointer, like config's own current Config, since
+// handlerPost and handlerSearch read it concurrently with a reload
+// replacing it.
+var spamFilter atomic.Pointer[moderation.Filter]
 
 func main() {
+	if err := config.Init("config.yaml"); err != nil {
+		panic(err)
+	}
+	cfg := config.Get()
+
+	store, err := NewBlobStore(storageConfig(cfg))
+	if err != nil {
+		panic(err)
+	}
+	blobStore = store
+
 	// Create a client
-	client, err := elastic.NewClient(elastic.SetURL(ES_URL), elastic.SetSniff(false))
+	client, err := elastic.NewClient(elastic.SetURL(cfg.Elasticsearch.URLs...), elastic.SetSniff(false))
 	if err != nil {
 		panic(err)
 		return
@@ -69,6 +99,13 @@ func main() {
 					"properties":{
 						"location":{
 							"type":"geo_point"
+						},
+						"timestamp":{
+							"type":"date",
+							"format":"epoch_second"
+						},
+						"user":{
+							"type":"keyword"
 						}
 					}
 				}
@@ -81,30 +118,88 @@ func main() {
 		}
 	}
 
+	ctx := context.Background()
+
+	natsConn, err = nats.Connect(cfg.Pipeline.NatsURL)
+	if err != nil {
+		panic(err)
+	}
+
+	btClient, err := bigtable.NewClient(ctx, cfg.BigTable.ProjectID, cfg.BigTable.Instance)
+	if err != nil {
+		panic(err)
+	}
+
+	btStatusStore, err := pipeline.NewBigTableStatusStore(ctx, cfg.BigTable.ProjectID, cfg.BigTable.Instance)
+	if err != nil {
+		panic(err)
+	}
+	statusStore = btStatusStore
+
+	p := pipeline.NewPipeline(natsConn, cfg.Pipeline.Subject, cfg.Pipeline.DeadLetterSubject,
+		[]pipeline.Writer{newESWriter(client), newBigTableWriter(btClient)}, statusStore)
+	if err := p.Start(cfg.Pipeline.Workers); err != nil {
+		panic(err)
+	}
+
+	filter := newSpamFilter(cfg)
+	spamFilter.Store(&filter)
+	config.OnReload(func(cfg *config.Config) {
+		filter := newSpamFilter(cfg)
+		spamFilter.Store(&filter)
+	})
+
+	signingKeys := make(map[string][]byte, len(cfg.Auth.SigningKeys))
+	for kid, key := range cfg.Auth.SigningKeys {
+		signingKeys[kid] = []byte(key)
+	}
+	ks, err := tokens.NewKeySet(signingKeys, cfg.Auth.ActiveKid)
+	if err != nil {
+		panic(err)
+	}
+	keySet = ks
+	refreshStore = tokens.NewBigTableRefreshStore(btClient)
+	revocationChecker = tokens.NewRevocationChecker(tokens.NewBigTableRevocationStore(btClient))
+
 	fmt.Println("Started-Service")
 
 	r := mux.NewRouter()
 
 	var jwtMiddleware = jwtmiddleware.New(jwtmiddleware.Options{
-		ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
-			return mySigningKey, nil
-		},
-		SigningMethod: jwt.SigningMethodHS256,
+		ValidationKeyGetter: keySet.Keyfunc,
+		SigningMethod:       jwt.SigningMethodHS256,
 	})
 	//Recall that: Original version: http.HandlerFunc("/post", handlerPost)
 	// Here we use jwtMiddleware before executing http.HanderFunc(...),
 	// since jwtMiddleware can check if client's token is valid or not.
-	// If invalid, we will reject them.
-	r.Handle("/post", jwtMiddleware.Handler(http.HandlerFunc(handlerPost))).Methods("POST")    // endpoint and doPost
-	r.Handle("/search", jwtMiddleware.Handler(http.HandlerFunc(handlerSearch))).Methods("GET") // endpoint and doPost
+	// If invalid, we will reject them. Beyond signature checks, requireActive
+	// also rejects a refresh token and a token whose jti was revoked by /logout.
+	requireActive := func(h http.HandlerFunc) http.Handler {
+		return jwtMiddleware.Handler(tokens.RevocationMiddleware(revocationChecker)(h))
+	}
+	r.Handle("/post", requireActive(handlerPost)).Methods("POST")            // endpoint and doPost
+	r.Handle("/search", requireActive(handlerSearch)).Methods("GET")         // endpoint and doPost
+	r.Handle("/posts/{id}", requireActive(handlerPostStatus)).Methods("GET") // ingestion status
 
-	// Users haven't got their tokens yet, no need to use jwtMiddleware for /login and /signup.
+	// Users haven't got their tokens yet for /login and /signup, and /refresh
+	// and /logout verify the refresh token in the request body themselves, so
+	// none of the four go through jwtMiddleware.
 	r.Handle("/login", http.HandlerFunc(loginHandler)).Methods("POST")
 	r.Handle("/signup", http.HandlerFunc(signupHandler)).Methods("POST")
-
-	http.Handle("/", r)
-
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	r.Handle("/refresh", http.HandlerFunc(refreshHandler)).Methods("POST")
+	r.Handle("/logout", http.HandlerFunc(logoutHandler)).Methods("POST")
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.Server.HTTP.WriteTimeout,
+	}
+	if cfg.Server.TLS.CertFile != "" {
+		log.Fatal(srv.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile))
+	}
+	log.Fatal(srv.ListenAndServe())
 }
 
 // {
@@ -119,7 +214,7 @@ func main() {
 
 func handlerPost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Origin", corsOrigin())
 	w.Header().Set("Access-Control-Allow-Header", "Content-Type,Authorization")
 
 	user := r.Context().Value("user")
@@ -143,6 +238,16 @@ func handlerPost(w http.ResponseWriter, r *http.Request) {
 			Lat: lat,
 			Lon: lon,
 		},
+		Timestamp: time.Now().Unix(),
+	}
+
+	ctx := context.Background()
+	if blocked, reason, err := (*spamFilter.Load()).Check(ctx, p.Message); err != nil {
+		fmt.Printf("moderation check failed, allowing post through: %v\n", err)
+	} else if blocked {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"error": "post rejected by moderation", "reason": reason})
+		return
 	}
 
 	id := uuid.New()
@@ -155,128 +260,85 @@ func handlerPost(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	ctx := context.Background() // context reads the credential then can access the data stored in GCS
-
-	_, attrs, err := saveToGCS(ctx, file, BUCKET_NAME, id)
-
+	url, err := blobStore.Put(ctx, id, file)
 	if err != nil {
-		http.Error(w, "GCS is not setup", http.StatusInternalServerError)
-		fmt.Printf("GCS is not setup %v\n", err)
+		http.Error(w, "blob store is not setup", http.StatusInternalServerError)
+		fmt.Printf("blob store is not setup %v\n", err)
 		panic(err)
 	}
 
-	p.Url = attrs.MediaLink
-
-	// save to elastic search
-	saveToES(p, id)
+	p.Url = url
 
-	// save to BigTable
-	// saveToBigTable(ctx, p, id, PROJECT_ID, BT_INSTANCE)
-}
-
-func saveToGCS(ctx context.Context, r io.Reader, bucketName string, name string) (*storage.ObjectHandle, *storage.ObjectAttrs, error) {
-	// create a new client
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, nil, err
-	}
-	// create a bucket instance
-	bucket := client.Bucket(bucketName)
-	// check if the bucket created exists
-	if _, err := bucket.Attrs(ctx); err != nil {
-		return nil, nil, err
-	}
-	// write files to the bucket
-	obj := bucket.Object(name)
-	wc := obj.NewWriter(ctx)
-	if _, err := io.Copy(wc, r); err != nil {
-		return nil, nil, err
-	}
-	if err := wc.Close(); err != nil {
-		return nil, nil, err
-	}
-	// set Access Control List
-	if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		return nil, nil, err
-	}
-	// get url to the file
-	attrs, err := obj.Attrs(ctx)
-	fmt.Printf("Post is saved to GCS: %s\n", attrs.MediaLink)
-	return obj, attrs, err
-}
-
-func saveToES(p *Post, id string) {
-	es_client, err := elastic.NewClient(elastic.SetURL(ES_URL),
-		elastic.SetSniff(false))
-	if err != nil {
-		panic(err)
+	event := pipeline.PostCreated{
+		ID:        id,
+		User:      p.User,
+		Message:   p.Message,
+		Lat:       p.Location.Lat,
+		Lon:       p.Location.Lon,
+		ImageURL:  p.Url,
+		Timestamp: p.Timestamp,
 	}
-	_, err = es_client.Index().
-		Index(INDEX).
-		Type(TYPE).
-		Id(id).
-		BodyJson(p).
-		Refresh(true).
-		Do()
-	if err != nil {
-		panic(err)
+	if err := statusStore.Set(ctx, id, pipeline.StatusPending); err != nil {
+		fmt.Printf("failed to record pending status for %s: %v\n", id, err)
 	}
-	fmt.Printf("Post is saved to index: %s\n", p.Message)
-}
-
-func saveToBigTable(ctx context.Context, p *Post, id string, PROJECT_ID string, BT_INSTANCE string) {
-	btClient, err := bigtable.NewClient(ctx, PROJECT_ID, BT_INSTANCE)
-	if err != nil {
-		panic(err)
+	if err := pipeline.Publish(natsConn, config.Get().Pipeline.Subject, event); err != nil {
+		http.Error(w, "failed to queue post for ingestion", http.StatusInternalServerError)
+		fmt.Printf("failed to publish PostCreated for %s: %v\n", id, err)
 		return
 	}
 
-	tbl := btClient.Open("post")
-	mut := bigtable.NewMutation()
-	t := bigtable.Now() // timestamp
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"id": id})
+}
 
-	mut.Set("post", "user", t, []byte(p.User)) // convert data to byte array
-	mut.Set("post", "message", t, []byte(p.Message))
-	mut.Set("location", "lat", t, []byte(strconv.FormatFloat(p.Location.Lat, 'f', -1, 64)))
-	mut.Set("location", "lon", t, []byte(strconv.FormatFloat(p.Location.Lon, 'f', -1, 64)))
+// handlerPostStatus reports how far ingestion of a previously-posted image
+// has gotten: pending while the pipeline workers are still writing it to
+// Elasticsearch/BigTable, indexed once they've succeeded, or failed if any
+// writer's retries were exhausted.
+func handlerPostStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", corsOrigin())
 
-	err = tbl.Apply(ctx, id, mut) // apply changes to table
+	id := mux.Vars(r)["id"]
+	status, err := statusStore.Get(r.Context(), id)
 	if err != nil {
-		panic(err)
+		http.Error(w, "post not found", http.StatusNotFound)
 		return
 	}
-	fmt.Printf("Post is saved to BigTable : %s\n", p.Message)
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "status": string(status)})
+}
+
+// corsOrigin returns the first configured CORS origin, defaulting to "*"
+// when none is configured so local/dev setups keep working.
+func corsOrigin() string {
+	origins := config.Get().CORS.AllowedOrigins
+	if len(origins) == 0 {
+		return "*"
+	}
+	return origins[0]
 }
 
 func handlerSearch(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received one request for search")
-	lat, _ := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
-	lon, _ := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+	cfg := config.Get()
+	params := parseSearchParams(r, cfg.Search.DefaultDistance)
 
-	// range is optional
-	ran := DISTANCE
-	if val := r.URL.Query().Get("range"); val != "" {
-		ran = val + "km"
-	}
-
-	fmt.Printf("Search received: %f %f %s\n", lat, lon, ran)
+	fmt.Printf("Search received: %f %f %s\n", params.Lat, params.Lon, params.Range)
 
 	// Create a client
-	client, err := elastic.NewClient(elastic.SetURL(ES_URL), elastic.SetSniff(false))
+	client, err := elastic.NewClient(elastic.SetURL(cfg.Elasticsearch.URLs...), elastic.SetSniff(false))
 	if err != nil {
 		panic(err)
 		return
 	}
 
-	// Define geo distance query as specified in
-	// https://www.elastic.co/guide/en/elasticsearch/reference/5.2/query-dsl-geo-distance-query.html
-	q := elastic.NewGeoDistanceQuery("location")
-	q = q.Distance(ran).Lat(lat).Lon(lon)
-
 	// Some delay may range from seconds to minutes. So if you don't get enough results. Try it later.
 	searchResult, err := client.Search().
 		Index(INDEX).
-		Query(q).
+		Query(params.buildQuery()).
+		Highlight(highlighter()).
+		From(params.From_).
+		Size(params.Size).
 		Pretty(true).
 		Do()
 	if err != nil {
@@ -290,47 +352,110 @@ func handlerSearch(w http.ResponseWriter, r *http.Request) {
 	// TotalHits is another convenience function that works even when something goes wrong.
 	fmt.Printf("Found a total of %d post\n", searchResult.TotalHits())
 
-	// Each is a convenience function that iterates over hits in a search result.
-	// It makes sure you don't need to check for nil values in the response.
-	// However, it ignores errors in serialization.
-	var typ Post
-	var ps []Post
-	for _, item := range searchResult.Each(reflect.TypeOf(typ)) { // instance of
-		p := item.(Post) // p = (Post) item
+	resp := SearchResponse{Total: searchResult.TotalHits()}
+	for _, hit := range searchResult.Hits.Hits {
+		var p Post
+		if err := json.Unmarshal(*hit.Source, &p); err != nil {
+			// searchResult.Each silently drops a hit whose _source fails to
+			// decode, which desyncs it from Hits.Hits and mismatches every
+			// highlight after it. Unmarshaling each hit ourselves keeps p
+			// and hit.Highlight paired correctly instead.
+			fmt.Printf("failed to unmarshal search hit %s: %v\n", hit.Id, err)
+			continue
+		}
 		fmt.Printf("Post by %s: %s at lat %v and lon %v\n", p.User, p.Message, p.Location.Lat, p.Location.Lon)
 		// Perform filtering based on keywords such as web spam etc.
-		if !containsSpam(&p.Message) {
-			ps = append(ps, p)
-		} else {
-			fmt.Printf("Post %s contains spam words, not allowed to display!\n", p.Message)
+		if blocked, reason, err := (*spamFilter.Load()).Check(r.Context(), p.Message); err != nil {
+			fmt.Printf("moderation check failed for post %q, allowing it through: %v\n", p.Message, err)
+		} else if blocked {
+			fmt.Printf("Post %q blocked by moderation: %s\n", p.Message, reason)
+			continue
 		}
+		resp.Hits = append(resp.Hits, buildHit(p, hit.Highlight))
 	}
-	js, err := json.Marshal(ps)
+	js, err := json.Marshal(resp)
 	if err != nil {
 		panic(err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Origin", corsOrigin())
 	w.Write(js)
 }
 
-func initSpamWordsSet() []string {
-	filteredWords := []string{
-		"fuck",
-		"shit",
-		"bitch",
+// storageConfig translates cfg.Storage into the StorageConfig NewBlobStore
+// expects, falling back to cfg.GCS.Bucket for the "gcs" provider so existing
+// deployments that never set storage.* keep working unchanged.
+func storageConfig(cfg *config.Config) StorageConfig {
+	s := cfg.Storage
+	return StorageConfig{
+		Provider: s.Provider,
+
+		GCSBucket: cfg.GCS.Bucket,
+
+		S3Bucket:          s.S3.Bucket,
+		S3Region:          s.S3.Region,
+		S3Endpoint:        s.S3.Endpoint,
+		S3AccessKeyID:     s.S3.AccessKeyID,
+		S3SecretAccessKey: s.S3.SecretAccessKey,
+
+		AzureAccountName:   s.Azure.AccountName,
+		AzureAccountKey:    s.Azure.AccountKey,
+		AzureContainerName: s.Azure.ContainerName,
+
+		SwiftUsername:  s.Swift.Username,
+		SwiftPassword:  s.Swift.Password,
+		SwiftTenant:    s.Swift.Tenant,
+		SwiftDomain:    s.Swift.Domain,
+		SwiftAuthURL:   s.Swift.AuthURL,
+		SwiftContainer: s.Swift.Container,
 	}
-	return filteredWords
 }
 
-func containsSpam(s *string) bool {
-	spamSet := initSpamWordsSet()
-	for _, spamWord := range spamSet {
-		if strings.Contains(*s, spamWord) {
-			return true
+// newSpamFilter builds the moderation.MultiFilter handlerPost and
+// handlerSearch both consult: a word list, regex patterns for obfuscated
+// spam, and (if configured) a remote toxicity classifier.
+func newSpamFilter(cfg *config.Config) moderation.Filter {
+	filters := []moderation.Filter{
+		moderation.NewWordListFilter(spamWords(cfg.Moderation.WordListPath)),
+	}
+
+	if len(cfg.Moderation.RegexPatterns) > 0 {
+		regexFilter, err := moderation.NewRegexFilter(cfg.Moderation.RegexPatterns)
+		if err != nil {
+			panic(err)
+		}
+		filters = append(filters, regexFilter)
+	}
+
+	if cfg.Moderation.RemoteClassifier.Endpoint != "" {
+		rc := cfg.Moderation.RemoteClassifier
+		filters = append(filters, moderation.NewRemoteClassifierFilter(
+			rc.Endpoint, rc.Threshold, rc.Timeout, rc.MaxFailures, rc.Cooldown))
+	}
+
+	return moderation.NewMultiFilter(filters...)
+}
+
+// spamWords loads the configured word list, falling back to a small
+// built-in default so moderation still works with no config.yaml entry.
+func spamWords(path string) []string {
+	defaultWords := []string{"fuck", "shit", "bitch"}
+	if path == "" {
+		return defaultWords
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Printf("spam word list %s not readable, falling back to defaults: %v\n", path, err)
+		return defaultWords
+	}
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			words = append(words, line)
 		}
 	}
-	return false
+	return words
 }
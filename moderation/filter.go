@@ -0,0 +1,42 @@
+// Package moderation decides whether a post or search result should be
+// blocked as spam/abuse. It replaces a single hardcoded word list with a
+// pluggable Filter interface so new detection strategies can be added
+// without touching call sites.
+package moderation
+
+import "context"
+
+// Filter inspects a message and reports whether it should be blocked, plus
+// a human-readable reason a caller can surface instead of silently
+// dropping the post.
+type Filter interface {
+	Check(ctx context.Context, message string) (blocked bool, reason string, err error)
+}
+
+// MultiFilter runs a list of Filters in order and blocks on the first one
+// that does. A filter erroring doesn't block the message on its own; it's
+// logged by the caller and the remaining filters still run.
+type MultiFilter struct {
+	filters []Filter
+}
+
+func NewMultiFilter(filters ...Filter) *MultiFilter {
+	return &MultiFilter{filters: filters}
+}
+
+func (m *MultiFilter) Check(ctx context.Context, message string) (bool, string, error) {
+	var firstErr error
+	for _, f := range m.filters {
+		blocked, reason, err := f.Check(ctx, message)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if blocked {
+			return true, reason, nil
+		}
+	}
+	return false, "", firstErr
+}
@@ -0,0 +1,36 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// RegexFilter catches obfuscated spam (leetspeak, spaced-out letters) that
+// a literal word list misses, e.g. "f u c k" or "sh1t".
+type RegexFilter struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRegexFilter compiles each pattern once at startup; a bad pattern in
+// config fails fast here rather than on the first matching request.
+func NewRegexFilter(patterns []string) (*RegexFilter, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("moderation: invalid regex pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return &RegexFilter{patterns: compiled}, nil
+}
+
+func (f *RegexFilter) Check(ctx context.Context, message string) (bool, string, error) {
+	for _, re := range f.patterns {
+		if re.MatchString(message) {
+			return true, fmt.Sprintf("matched pattern %q", re.String()), nil
+		}
+	}
+	return false, "", nil
+}
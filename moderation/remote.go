@@ -0,0 +1,132 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RemoteClassifierFilter delegates to an HTTP toxicity classifier (e.g. a
+// Perspective API-compatible endpoint) and blocks when the returned score
+// exceeds Threshold. A circuit breaker fails open when the classifier is
+// down, so an outage there degrades moderation instead of taking down
+// search.
+type RemoteClassifierFilter struct {
+	endpoint  string
+	threshold float64
+	client    *http.Client
+	breaker   *circuitBreaker
+}
+
+// NewRemoteClassifierFilter builds a filter that POSTs {"text": message} to
+// endpoint and expects back {"score": float64}. timeout bounds each call;
+// after maxFailures consecutive failures the breaker opens for cooldown
+// before trying the endpoint again.
+func NewRemoteClassifierFilter(endpoint string, threshold float64, timeout time.Duration, maxFailures int, cooldown time.Duration) *RemoteClassifierFilter {
+	return &RemoteClassifierFilter{
+		endpoint:  endpoint,
+		threshold: threshold,
+		client:    &http.Client{Timeout: timeout},
+		breaker:   newCircuitBreaker(maxFailures, cooldown),
+	}
+}
+
+type classifyRequest struct {
+	Text string `json:"text"`
+}
+
+type classifyResponse struct {
+	Score float64 `json:"score"`
+}
+
+func (f *RemoteClassifierFilter) Check(ctx context.Context, message string) (bool, string, error) {
+	if !f.breaker.allow() {
+		return false, "", nil
+	}
+
+	body, err := json.Marshal(classifyRequest{Text: message})
+	if err != nil {
+		return false, "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, f.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		f.breaker.recordFailure()
+		return false, "", nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		f.breaker.recordFailure()
+		return false, "", nil
+	}
+
+	var cr classifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		f.breaker.recordFailure()
+		return false, "", nil
+	}
+	f.breaker.recordSuccess()
+
+	if cr.Score > f.threshold {
+		return true, fmt.Sprintf("toxicity score %.2f exceeds threshold %.2f", cr.Score, f.threshold), nil
+	}
+	return false, "", nil
+}
+
+// circuitBreaker opens after maxFailures consecutive failures and stays
+// open for cooldown, during which allow() returns false so callers skip
+// the remote call entirely.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	maxFailures int
+	cooldown    time.Duration
+	failures    int
+	openUntil   time.Time
+}
+
+func newCircuitBreaker(maxFailures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{maxFailures: maxFailures, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) {
+		return false
+	}
+	// Cooldown elapsed: close the breaker and reset the failure count, so
+	// calls reach the endpoint again until another maxFailures in a row.
+	b.openUntil = time.Time{}
+	b.failures = 0
+	return true
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.maxFailures {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
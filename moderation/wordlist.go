@@ -0,0 +1,120 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ahoNode is one state in the Aho-Corasick automaton: a trie node plus the
+// failure link and accumulated output used to scan a whole message in a
+// single pass instead of one substring search per word.
+type ahoNode struct {
+	children map[rune]*ahoNode
+	fail     *ahoNode
+	word     string   // non-empty if a pattern ends exactly at this node
+	output   []string // every pattern that matches at this node, including ones inherited via fail links
+}
+
+func newAhoNode() *ahoNode {
+	return &ahoNode{children: make(map[rune]*ahoNode)}
+}
+
+// sortedRunes returns m's keys in a stable order, so callers that walk a
+// node's children get deterministic results instead of Go's randomized
+// map iteration order.
+func sortedRunes(m map[rune]*ahoNode) []rune {
+	runes := make([]rune, 0, len(m))
+	for r := range m {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes
+}
+
+// WordListFilter blocks a message that contains any word from a
+// configured list, scanning the whole message in O(n+matches) via an
+// Aho-Corasick automaton rather than one strings.Contains per word.
+type WordListFilter struct {
+	root *ahoNode
+}
+
+// NewWordListFilter builds the trie from words, then computes fail links
+// with a BFS from the root's children: each node's fail pointer follows
+// its parent's fail chain until a child with the same rune is found, else
+// falls back to root. Output sets are inherited through fail links so a
+// match is found even when it ends inside a longer non-matching run.
+func NewWordListFilter(words []string) *WordListFilter {
+	root := newAhoNode()
+	for _, w := range words {
+		w = strings.ToLower(w)
+		cur := root
+		for _, r := range w {
+			next, ok := cur.children[r]
+			if !ok {
+				next = newAhoNode()
+				cur.children[r] = next
+			}
+			cur = next
+		}
+		cur.word = w
+		// Own-word output is recorded now, at insertion, rather than when
+		// the BFS below dequeues the node - otherwise a fail link built
+		// before that dequeue would copy an incomplete output set.
+		cur.output = append(cur.output, w)
+	}
+
+	// Children are visited in a stable (sorted) order instead of ranged
+	// over directly, so fail-link construction doesn't depend on Go's
+	// randomized map iteration order.
+	var queue []*ahoNode
+	for _, r := range sortedRunes(root.children) {
+		child := root.children[r]
+		child.fail = root
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, r := range sortedRunes(cur.children) {
+			child := cur.children[r]
+			fail := cur.fail
+			for fail != nil {
+				if next, ok := fail.children[r]; ok {
+					child.fail = next
+					break
+				}
+				fail = fail.fail
+			}
+			if child.fail == nil {
+				child.fail = root
+			}
+			child.output = append(child.output, child.fail.output...)
+			queue = append(queue, child)
+		}
+	}
+
+	return &WordListFilter{root: root}
+}
+
+// Check walks the automaton once over message, advancing on a miss via the
+// fail link the same way a KMP search falls back on a partial match.
+func (f *WordListFilter) Check(ctx context.Context, message string) (bool, string, error) {
+	cur := f.root
+	for _, r := range strings.ToLower(message) {
+		for cur != f.root {
+			if _, ok := cur.children[r]; ok {
+				break
+			}
+			cur = cur.fail
+		}
+		if next, ok := cur.children[r]; ok {
+			cur = next
+		}
+		if len(cur.output) > 0 {
+			return true, fmt.Sprintf("matched spam word %q", cur.output[0]), nil
+		}
+	}
+	return false, "", nil
+}
@@ -0,0 +1,59 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+)
+
+// TestWordListFilterFailLinkOutput pins the bug fixed in a168bf7d: a word
+// reachable only via a fail link (here "b", inside the automaton built for
+// "abc") must still be found even though it never appears as a standalone
+// match start in the scanned text.
+func TestWordListFilterFailLinkOutput(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		f := NewWordListFilter([]string{"b", "abc"})
+		blocked, reason, err := f.Check(context.Background(), "zabx")
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if !blocked {
+			t.Fatalf("run %d: Check(%q) = false, want true (word %q should match via fail link)", i, "zabx", "b")
+		}
+		if reason == "" {
+			t.Errorf("run %d: Check(%q) returned blocked=true with an empty reason", i, "zabx")
+		}
+	}
+}
+
+func TestWordListFilterMatch(t *testing.T) {
+	f := NewWordListFilter([]string{"spam", "junk"})
+
+	cases := []struct {
+		message string
+		blocked bool
+	}{
+		{"this is a fine message", false},
+		{"buy SPAM now", true},
+		{"totally junk mail", true},
+	}
+	for _, c := range cases {
+		blocked, _, err := f.Check(context.Background(), c.message)
+		if err != nil {
+			t.Fatalf("Check(%q): %v", c.message, err)
+		}
+		if blocked != c.blocked {
+			t.Errorf("Check(%q) = %v, want %v", c.message, blocked, c.blocked)
+		}
+	}
+}
+
+func TestWordListFilterEmptyWordList(t *testing.T) {
+	f := NewWordListFilter(nil)
+	blocked, _, err := f.Check(context.Background(), "anything goes")
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if blocked {
+		t.Error("Check with an empty word list should never block")
+	}
+}
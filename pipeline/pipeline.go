@@ -0,0 +1,202 @@
+// Package pipeline decouples the HTTP handler from the slow backends a post
+// fans out to. handlerPost publishes a PostCreated event and returns
+// immediately; a pool of workers subscribed to the same NATS subject does
+// the actual Elasticsearch and BigTable writes, each with its own
+// retry/backoff, and records progress in a StatusStore so clients can poll
+// GET /posts/{id} for the outcome.
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/nats-io/nats.go"
+)
+
+// PostCreated is published once a post's image has been uploaded to blob
+// storage. It carries everything a downstream writer needs, so writers
+// never have to call back into the HTTP-facing Post type.
+type PostCreated struct {
+	ID        string  `json:"id"`
+	User      string  `json:"user"`
+	Message   string  `json:"message"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	ImageURL  string  `json:"imageUrl"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// Status is the lifecycle of one post as it moves through the pipeline.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusIndexed Status = "indexed"
+	StatusFailed  Status = "failed"
+)
+
+// StatusStore records, per post id, how far ingestion has progressed.
+type StatusStore interface {
+	Set(ctx context.Context, id string, status Status) error
+	Get(ctx context.Context, id string) (Status, error)
+}
+
+// BigTableStatusStore keeps status in a small "post_status" table, one row
+// per post id, so GET /posts/{id} can answer without touching ES.
+type BigTableStatusStore struct {
+	client *bigtable.Client
+}
+
+func NewBigTableStatusStore(ctx context.Context, projectID, instance string) (*BigTableStatusStore, error) {
+	client, err := bigtable.NewClient(ctx, projectID, instance)
+	if err != nil {
+		return nil, err
+	}
+	return &BigTableStatusStore{client: client}, nil
+}
+
+func (s *BigTableStatusStore) Set(ctx context.Context, id string, status Status) error {
+	tbl := s.client.Open("post_status")
+	mut := bigtable.NewMutation()
+	mut.Set("status", "state", bigtable.Now(), []byte(status))
+	return tbl.Apply(ctx, id, mut)
+}
+
+func (s *BigTableStatusStore) Get(ctx context.Context, id string) (Status, error) {
+	tbl := s.client.Open("post_status")
+	row, err := tbl.ReadRow(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	for _, items := range row["status"] {
+		if items.Column == "status:state" {
+			return Status(items.Value), nil
+		}
+	}
+	return "", fmt.Errorf("pipeline: no status recorded for %s", id)
+}
+
+// Writer fans a PostCreated event out to one backend. Implementations
+// should be idempotent since a failed Write is retried for the same event.
+// Messages come from a core NATS subscription with no acknowledgement, so a
+// message that no worker receives or finishes is not redelivered.
+type Writer interface {
+	Name() string
+	Write(ctx context.Context, event PostCreated) error
+}
+
+// RetryPolicy bounds how a failed Writer.Write is retried before the event
+// is given up on and sent to the dead-letter subject.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < attempt; i++ {
+		d *= 2
+	}
+	return d
+}
+
+// Pipeline subscribes to Subject on NATS with a queue group, so N workers
+// share the load, and fans every message out to all Writers.
+type Pipeline struct {
+	nc                *nats.Conn
+	subject           string
+	deadLetterSubject string
+	queueGroup        string
+	writers           []Writer
+	status            StatusStore
+	retry             RetryPolicy
+}
+
+func NewPipeline(nc *nats.Conn, subject, deadLetterSubject string, writers []Writer, status StatusStore) *Pipeline {
+	return &Pipeline{
+		nc:                nc,
+		subject:           subject,
+		deadLetterSubject: deadLetterSubject,
+		queueGroup:        "post-workers",
+		writers:           writers,
+		status:            status,
+		retry:             RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond},
+	}
+}
+
+// Publish sends a PostCreated event to the pipeline's subject.
+func Publish(nc *nats.Conn, subject string, event PostCreated) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return nc.Publish(subject, data)
+}
+
+// Start launches workerCount goroutines, each subscribed to the pipeline's
+// subject via the shared queue group so each message is delivered to only
+// one worker in the pool rather than to all of them.
+func (p *Pipeline) Start(workerCount int) error {
+	for i := 0; i < workerCount; i++ {
+		sub, err := p.nc.QueueSubscribe(p.subject, p.queueGroup, p.handleMessage)
+		if err != nil {
+			return err
+		}
+		sub.SetPendingLimits(-1, -1)
+	}
+	return nil
+}
+
+func (p *Pipeline) handleMessage(msg *nats.Msg) {
+	var event PostCreated
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		fmt.Printf("pipeline: dropping malformed message: %v\n", err)
+		p.deadLetter(msg.Data)
+		return
+	}
+
+	ctx := context.Background()
+	ok := true
+	for _, w := range p.writers {
+		if err := p.writeWithRetry(ctx, w, event); err != nil {
+			fmt.Printf("pipeline: %s failed permanently for post %s: %v\n", w.Name(), event.ID, err)
+			ok = false
+		}
+	}
+
+	status := StatusIndexed
+	if !ok {
+		status = StatusFailed
+		p.deadLetter(msg.Data)
+	}
+	if err := p.status.Set(ctx, event.ID, status); err != nil {
+		fmt.Printf("pipeline: failed to record status for post %s: %v\n", event.ID, err)
+	}
+}
+
+func (p *Pipeline) writeWithRetry(ctx context.Context, w Writer, event PostCreated) error {
+	var lastErr error
+	for attempt := 0; attempt < p.retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.retry.backoff(attempt))
+		}
+		if err := w.Write(ctx, event); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func (p *Pipeline) deadLetter(data []byte) {
+	if p.deadLetterSubject == "" {
+		return
+	}
+	if err := p.nc.Publish(p.deadLetterSubject, data); err != nil {
+		fmt.Printf("pipeline: failed to publish to dead-letter subject %s: %v\n", p.deadLetterSubject, err)
+	}
+}
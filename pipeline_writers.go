@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"cloud.google.com/go/bigtable"
+	elastic "gopkg.in/olivere/elastic.v3"
+
+	"github.com/yvettewang/Around/pipeline"
+)
+
+// esWriter indexes a PostCreated event into Elasticsearch, the same
+// document shape saveToES used to write synchronously.
+type esWriter struct {
+	client *elastic.Client
+}
+
+func newESWriter(client *elastic.Client) *esWriter {
+	return &esWriter{client: client}
+}
+
+func (w *esWriter) Name() string { return "elasticsearch" }
+
+func (w *esWriter) Write(ctx context.Context, event pipeline.PostCreated) error {
+	p := Post{
+		User:      event.User,
+		Message:   event.Message,
+		Location:  Location{Lat: event.Lat, Lon: event.Lon},
+		Url:       event.ImageURL,
+		Timestamp: event.Timestamp,
+	}
+	_, err := w.client.Index().
+		Index(INDEX).
+		Type(TYPE).
+		Id(event.ID).
+		BodyJson(p).
+		Refresh(true).
+		Do()
+	return err
+}
+
+// bigTableWriter persists a PostCreated event to the "post" table, the
+// same columns saveToBigTable used to write synchronously.
+type bigTableWriter struct {
+	client *bigtable.Client
+}
+
+func newBigTableWriter(client *bigtable.Client) *bigTableWriter {
+	return &bigTableWriter{client: client}
+}
+
+func (w *bigTableWriter) Name() string { return "bigtable" }
+
+func (w *bigTableWriter) Write(ctx context.Context, event pipeline.PostCreated) error {
+	tbl := w.client.Open("post")
+	mut := bigtable.NewMutation()
+	t := bigtable.Now()
+
+	mut.Set("post", "user", t, []byte(event.User))
+	mut.Set("post", "message", t, []byte(event.Message))
+	mut.Set("location", "lat", t, []byte(strconv.FormatFloat(event.Lat, 'f', -1, 64)))
+	mut.Set("location", "lon", t, []byte(strconv.FormatFloat(event.Lon, 'f', -1, 64)))
+
+	return tbl.Apply(ctx, event.ID, mut)
+}
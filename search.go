@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	elastic "gopkg.in/olivere/elastic.v3"
+)
+
+// SearchParams captures everything a client can narrow a /search request
+// down with, on top of the mandatory geo-distance filter.
+type SearchParams struct {
+	Lat, Lon float64
+	Range    string
+
+	Keyword string // free-text match against Post.Message
+	User    string // exact match against Post.User
+	From    int64  // unix seconds, inclusive lower bound on Post.Timestamp
+	To      int64  // unix seconds, inclusive upper bound on Post.Timestamp
+
+	From_ int // pagination offset ("from" is an ES reserved word, avoid shadowing)
+	Size  int // pagination page size
+}
+
+// parseSearchParams reads query string parameters into a SearchParams,
+// falling back to the given default range when "range" isn't supplied.
+func parseSearchParams(r *http.Request, defaultRange string) SearchParams {
+	q := r.URL.Query()
+
+	lat, _ := strconv.ParseFloat(q.Get("lat"), 64)
+	lon, _ := strconv.ParseFloat(q.Get("lon"), 64)
+
+	ran := defaultRange
+	if val := q.Get("range"); val != "" {
+		ran = val + "km"
+	}
+
+	from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+	to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+
+	page, _ := strconv.Atoi(q.Get("page_from"))
+	size, err := strconv.Atoi(q.Get("page_size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+
+	return SearchParams{
+		Lat: lat, Lon: lon, Range: ran,
+		Keyword: q.Get("q"), User: q.Get("user"),
+		From: from, To: to,
+		From_: page, Size: size,
+	}
+}
+
+// buildQuery assembles the bool query: the geo-distance filter is always
+// present, the keyword/user/time-range clauses are added only when the
+// caller supplied them.
+func (p SearchParams) buildQuery() elastic.Query {
+	geo := elastic.NewGeoDistanceQuery("location").Distance(p.Range).Lat(p.Lat).Lon(p.Lon)
+
+	bq := elastic.NewBoolQuery().Filter(geo)
+
+	if p.Keyword != "" {
+		bq = bq.Must(elastic.NewMatchQuery("message", p.Keyword))
+	}
+	if p.User != "" {
+		bq = bq.Filter(elastic.NewTermQuery("user", p.User))
+	}
+	if p.From > 0 || p.To > 0 {
+		rq := elastic.NewRangeQuery("timestamp")
+		if p.From > 0 {
+			rq = rq.Gte(p.From)
+		}
+		if p.To > 0 {
+			rq = rq.Lte(p.To)
+		}
+		bq = bq.Filter(rq)
+	}
+	return bq
+}
+
+// SearchHit is one result, carrying both the matched post and the
+// highlight metadata a faceted-search frontend renders a snippet from.
+type SearchHit struct {
+	Post    Post                 `json:"post"`
+	Matches map[string]MatchInfo `json:"matches"`
+}
+
+// MatchInfo describes how a single field matched the query, mirroring the
+// shape used by faceted-search frontends so clients don't have to
+// recompute highlighting themselves.
+type MatchInfo struct {
+	Value            string   `json:"value"`
+	MatchLevel       string   `json:"matchLevel"` // "none" or "full"
+	FullyHighlighted bool     `json:"fullyHighlighted"`
+	MatchedWords     []string `json:"matchedWords"`
+}
+
+// SearchResponse is the structured envelope returned by /search.
+type SearchResponse struct {
+	Total int64       `json:"total"`
+	Hits  []SearchHit `json:"hits"`
+}
+
+// highlighter configures ES's highlight API for the "message" field so
+// buildHit can populate MatchInfo straight from the response.
+func highlighter() *elastic.Highlight {
+	return elastic.NewHighlight().Fields(elastic.NewHighlighterField("message"))
+}
+
+// buildHit turns one ES hit plus its highlight fragments into a SearchHit.
+func buildHit(p Post, highlights elastic.SearchHitHighlight) SearchHit {
+	fragments, found := highlights["message"]
+	matchInfo := MatchInfo{Value: p.Message, MatchLevel: "none"}
+	if found && len(fragments) > 0 {
+		matchInfo.MatchLevel = "full"
+		matchInfo.MatchedWords = extractHighlightedWords(fragments)
+		matchInfo.FullyHighlighted = len(fragments) == 1 && fragments[0] == "<em>"+p.Message+"</em>"
+	}
+	return SearchHit{
+		Post:    p,
+		Matches: map[string]MatchInfo{"message": matchInfo},
+	}
+}
+
+// extractHighlightedWords pulls the text ES wrapped in <em> out of each
+// highlight fragment.
+func extractHighlightedWords(fragments []string) []string {
+	var words []string
+	for _, fragment := range fragments {
+		rest := fragment
+		for {
+			start := strings.Index(rest, "<em>")
+			if start == -1 {
+				break
+			}
+			rest = rest[start+len("<em>"):]
+			end := strings.Index(rest, "</em>")
+			if end == -1 {
+				break
+			}
+			words = append(words, rest[:end])
+			rest = rest[end+len("</em>"):]
+		}
+	}
+	return words
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	elastic "gopkg.in/olivere/elastic.v3"
+)
+
+func TestParseSearchParamsDefaults(t *testing.T) {
+	r := httptest.NewRequest("GET", "/search?lat=37.1&lon=-120.2", nil)
+	p := parseSearchParams(r, "200km")
+
+	if p.Range != "200km" {
+		t.Errorf("Range = %q, want %q", p.Range, "200km")
+	}
+	if p.Size != 20 {
+		t.Errorf("Size = %d, want 20", p.Size)
+	}
+	if p.Keyword != "" || p.User != "" {
+		t.Errorf("Keyword/User = %q/%q, want both empty", p.Keyword, p.User)
+	}
+}
+
+func TestParseSearchParamsOverrides(t *testing.T) {
+	r := httptest.NewRequest("GET", "/search?lat=1&lon=2&range=50&q=hello&user=bob&from=100&to=200&page_from=2&page_size=5", nil)
+	p := parseSearchParams(r, "200km")
+
+	if p.Range != "50km" {
+		t.Errorf("Range = %q, want %q", p.Range, "50km")
+	}
+	if p.Keyword != "hello" || p.User != "bob" {
+		t.Errorf("Keyword/User = %q/%q, want hello/bob", p.Keyword, p.User)
+	}
+	if p.From != 100 || p.To != 200 {
+		t.Errorf("From/To = %d/%d, want 100/200", p.From, p.To)
+	}
+	if p.From_ != 2 || p.Size != 5 {
+		t.Errorf("From_/Size = %d/%d, want 2/5", p.From_, p.Size)
+	}
+}
+
+func TestBuildQueryOnlyAddsSuppliedClauses(t *testing.T) {
+	base := SearchParams{Lat: 1, Lon: 2, Range: "10km"}
+	src, err := base.buildQuery().Source()
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	bq := src.(map[string]interface{})["bool"].(map[string]interface{})
+	if _, ok := bq["must"]; ok {
+		t.Errorf("bool query has a must clause with no keyword supplied: %v", bq)
+	}
+	// elastic.v3 renders a single filter clause as a bare object and only
+	// switches to an array once there's more than one.
+	if _, ok := bq["filter"].(map[string]interface{})["geo_distance"]; !ok {
+		t.Errorf("filter clause isn't the bare geo-distance query: %v", bq["filter"])
+	}
+
+	full := SearchParams{Lat: 1, Lon: 2, Range: "10km", Keyword: "hi", User: "bob", From: 1, To: 2}
+	src, err = full.buildQuery().Source()
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	bq = src.(map[string]interface{})["bool"].(map[string]interface{})
+	if _, ok := bq["must"]; !ok {
+		t.Errorf("bool query is missing the keyword must clause: %v", bq)
+	}
+	filters, _ := bq["filter"].([]interface{})
+	if len(filters) != 3 {
+		t.Errorf("filter clauses = %d, want 3 (geo-distance, user, time range)", len(filters))
+	}
+}
+
+func TestBuildHitNoHighlight(t *testing.T) {
+	p := Post{User: "bob", Message: "hello world"}
+	hit := buildHit(p, nil)
+
+	info := hit.Matches["message"]
+	if info.MatchLevel != "none" {
+		t.Errorf("MatchLevel = %q, want %q", info.MatchLevel, "none")
+	}
+	if info.FullyHighlighted {
+		t.Error("FullyHighlighted = true with no highlight fragments")
+	}
+	if len(info.MatchedWords) != 0 {
+		t.Errorf("MatchedWords = %v, want empty", info.MatchedWords)
+	}
+}
+
+func TestBuildHitPartialHighlight(t *testing.T) {
+	p := Post{User: "bob", Message: "hello there world"}
+	highlights := elastic.SearchHitHighlight{"message": []string{"hello <em>there</em> world"}}
+	hit := buildHit(p, highlights)
+
+	info := hit.Matches["message"]
+	if info.MatchLevel != "full" {
+		t.Errorf("MatchLevel = %q, want %q", info.MatchLevel, "full")
+	}
+	if info.FullyHighlighted {
+		t.Error("FullyHighlighted = true for a fragment that only highlights part of the message")
+	}
+	if len(info.MatchedWords) != 1 || info.MatchedWords[0] != "there" {
+		t.Errorf("MatchedWords = %v, want [there]", info.MatchedWords)
+	}
+}
+
+func TestBuildHitFullyHighlighted(t *testing.T) {
+	p := Post{User: "bob", Message: "hello"}
+	highlights := elastic.SearchHitHighlight{"message": []string{"<em>hello</em>"}}
+	hit := buildHit(p, highlights)
+
+	info := hit.Matches["message"]
+	if !info.FullyHighlighted {
+		t.Error("FullyHighlighted = false for a fragment that highlights the whole message")
+	}
+}
+
+func TestExtractHighlightedWordsMultipleFragments(t *testing.T) {
+	words := extractHighlightedWords([]string{"a <em>cat</em> and a <em>dog</em>", "no match here"})
+	if len(words) != 2 || words[0] != "cat" || words[1] != "dog" {
+		t.Errorf("words = %v, want [cat dog]", words)
+	}
+}
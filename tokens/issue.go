@@ -0,0 +1,64 @@
+package tokens
+
+import (
+	"time"
+
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// AccessTokenTTL is deliberately short so a compromised access token
+	// is only useful for a few minutes; refresh tokens carry the actual
+	// session lifetime.
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is the outer bound on how long a user stays logged
+	// in without re-entering credentials.
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Claims is embedded in both access and refresh tokens. Type distinguishes
+// the two so a refresh token can't be used directly as an access token.
+type Claims struct {
+	jwt.StandardClaims
+	Username string `json:"username"`
+	Type     string `json:"type"` // "access" or "refresh"
+}
+
+// NewAccessToken mints a short-lived access token for username. sessionID is
+// shared with the refresh token it was issued alongside (or reissued from),
+// so revoking that session's jti via /logout blocks this access token too
+// instead of leaving it valid until its own TTL expires.
+func (ks *KeySet) NewAccessToken(username, sessionID string) (string, Claims, error) {
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
+			Subject:   username,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+		},
+		Username: username,
+		Type:     "access",
+	}
+	signed, err := ks.Sign(claims)
+	return signed, claims, err
+}
+
+// NewRefreshToken mints a longer-lived refresh token for username, with a
+// fresh session id. The caller is responsible for persisting that jti so it
+// can later be looked up and revoked, and for minting the paired access
+// token with the same jti via NewAccessToken.
+func (ks *KeySet) NewRefreshToken(username string) (string, Claims, error) {
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New(),
+			Subject:   username,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(RefreshTokenTTL).Unix(),
+		},
+		Username: username,
+		Type:     "refresh",
+	}
+	signed, err := ks.Sign(claims)
+	return signed, claims, err
+}
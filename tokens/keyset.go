@@ -0,0 +1,47 @@
+// Package tokens issues and verifies the JWTs used by /login, /signup,
+// /refresh and /logout, and tracks which ones have been revoked.
+package tokens
+
+import (
+	"fmt"
+
+	"github.com/form3tech-oss/jwt-go"
+)
+
+// KeySet holds every HS256 signing key the service currently accepts,
+// indexed by "kid" (key id). New tokens are always signed with ActiveKid,
+// but tokens signed with a retired key still verify until it's removed
+// from the set entirely, so rotating keys doesn't invalidate live sessions.
+type KeySet struct {
+	ActiveKid string
+	keys      map[string][]byte
+}
+
+func NewKeySet(keys map[string][]byte, activeKid string) (*KeySet, error) {
+	if _, ok := keys[activeKid]; !ok {
+		return nil, fmt.Errorf("tokens: active kid %q has no key", activeKid)
+	}
+	return &KeySet{ActiveKid: activeKid, keys: keys}, nil
+}
+
+// Sign signs claims with the active key and stamps the kid header so
+// Keyfunc can find the right key again at verification time.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ks.ActiveKid
+	return token.SignedString(ks.keys[ks.ActiveKid])
+}
+
+// Keyfunc is a jwt-go ValidationKeyGetter that selects the signing key by
+// the token's kid header instead of assuming a single global secret.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("tokens: token has no kid header")
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("tokens: unknown kid %q", kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,43 @@
+package tokens
+
+import (
+	"net/http"
+
+	"github.com/form3tech-oss/jwt-go"
+)
+
+// RevocationMiddleware wraps a handler that sits behind jwtMiddleware
+// (which already verified the signature and kid). It adds the checks
+// signature verification alone can't do: is this an access token rather
+// than a refresh token, and has this specific token been logged out.
+func RevocationMiddleware(checker *RevocationChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := r.Context().Value("user").(*jwt.Token)
+			if !ok {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "invalid token claims", http.StatusUnauthorized)
+				return
+			}
+			if typ, _ := claims["type"].(string); typ != "access" {
+				http.Error(w, "not an access token", http.StatusUnauthorized)
+				return
+			}
+			jti, _ := claims["jti"].(string)
+			revoked, err := checker.IsRevoked(r.Context(), jti)
+			if err != nil {
+				http.Error(w, "failed to check token revocation", http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				http.Error(w, "token has been revoked", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
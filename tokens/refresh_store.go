@@ -0,0 +1,64 @@
+package tokens
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"cloud.google.com/go/bigtable"
+)
+
+// RefreshStore persists refresh tokens so /refresh can check a presented
+// token is the one that was actually issued, and /logout can delete it.
+type RefreshStore interface {
+	Save(ctx context.Context, username, jti, token string) error
+	Verify(ctx context.Context, username, jti, token string) (bool, error)
+	Delete(ctx context.Context, username, jti string) error
+}
+
+// BigTableRefreshStore stores a sha256 of the token (never the token
+// itself) in a "tokens" column family, one row per "username#jti".
+type BigTableRefreshStore struct {
+	client *bigtable.Client
+}
+
+func NewBigTableRefreshStore(client *bigtable.Client) *BigTableRefreshStore {
+	return &BigTableRefreshStore{client: client}
+}
+
+func rowKey(username, jti string) string {
+	return username + "#" + jti
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *BigTableRefreshStore) Save(ctx context.Context, username, jti, token string) error {
+	tbl := s.client.Open("tokens")
+	mut := bigtable.NewMutation()
+	mut.Set("tokens", "hash", bigtable.Now(), []byte(hashToken(token)))
+	return tbl.Apply(ctx, rowKey(username, jti), mut)
+}
+
+func (s *BigTableRefreshStore) Verify(ctx context.Context, username, jti, token string) (bool, error) {
+	tbl := s.client.Open("tokens")
+	row, err := tbl.ReadRow(ctx, rowKey(username, jti))
+	if err != nil {
+		return false, err
+	}
+	for _, item := range row["tokens"] {
+		if item.Column == "tokens:hash" {
+			return string(item.Value) == hashToken(token), nil
+		}
+	}
+	return false, nil
+}
+
+func (s *BigTableRefreshStore) Delete(ctx context.Context, username, jti string) error {
+	tbl := s.client.Open("tokens")
+	mut := bigtable.NewMutation()
+	mut.DeleteRow()
+	return tbl.Apply(ctx, rowKey(username, jti), mut)
+}
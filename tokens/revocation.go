@@ -0,0 +1,68 @@
+package tokens
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigtable"
+)
+
+// RevocationStore answers "has this jti been logged out", backed by
+// BigTable so revocation survives a restart and is shared across
+// instances.
+type RevocationStore interface {
+	Revoke(ctx context.Context, jti string) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// BigTableRevocationStore keeps one row per revoked jti in a "revoked"
+// table; presence of the row means the token is revoked.
+type BigTableRevocationStore struct {
+	client *bigtable.Client
+}
+
+func NewBigTableRevocationStore(client *bigtable.Client) *BigTableRevocationStore {
+	return &BigTableRevocationStore{client: client}
+}
+
+func (s *BigTableRevocationStore) Revoke(ctx context.Context, jti string) error {
+	tbl := s.client.Open("revoked")
+	mut := bigtable.NewMutation()
+	mut.Set("revoked", "at", bigtable.Now(), []byte("1"))
+	return tbl.Apply(ctx, jti, mut)
+}
+
+func (s *BigTableRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	tbl := s.client.Open("revoked")
+	row, err := tbl.ReadRow(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	return len(row) > 0, nil
+}
+
+// RevocationChecker is what RevocationMiddleware calls on every request.
+//
+// An earlier version of this fronted store with a local in-process Bloom
+// filter to skip the BigTable round trip on the common "not revoked" path.
+// That only worked in a single, never-restarted instance: a /logout on one
+// instance never touched another instance's bits, and a restart zeroed the
+// filter and silently un-revoked every token it held, even though BigTable
+// still had the correct row. Since every instance needs to see a /logout
+// immediately, RevocationChecker just asks the (actually shared) store.
+type RevocationChecker struct {
+	store RevocationStore
+}
+
+func NewRevocationChecker(store RevocationStore) *RevocationChecker {
+	return &RevocationChecker{store: store}
+}
+
+// Revoke marks jti as revoked.
+func (c *RevocationChecker) Revoke(ctx context.Context, jti string) error {
+	return c.store.Revoke(ctx, jti)
+}
+
+// IsRevoked reports whether jti has been revoked.
+func (c *RevocationChecker) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return c.store.IsRevoked(ctx, jti)
+}